@@ -0,0 +1,199 @@
+// Package auth implements the operator/ban control plane used to keep
+// unwanted connections out of the chat: the first connected user becomes
+// an operator, and operators can kick, ban and unban other users.
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies what a Ban matches against.
+type Kind string
+
+const (
+	KindName Kind = "name"
+	KindIP   Kind = "ip"
+	KindAddr Kind = "addr"
+)
+
+// Ban is a single banlist entry. Until is the zero value for a permanent
+// ban.
+type Ban struct {
+	Kind  Kind      `json:"kind"`
+	Value string    `json:"value"`
+	Until time.Time `json:"until,omitempty"`
+}
+
+func (b Ban) expired(now time.Time) bool {
+	return !b.Until.IsZero() && !b.Until.After(now)
+}
+
+// Manager tracks operators and the banlist, persisting the latter to a
+// JSON file on every mutation.
+type Manager struct {
+	mu   sync.Mutex
+	path string
+	ops  map[string]bool
+	bans []Ban
+}
+
+// NewManager loads path (if it exists) and returns a Manager backed by
+// it. A missing file is not an error: it is created on first mutation.
+func NewManager(path string) (*Manager, error) {
+	m := &Manager{
+		path: path,
+		ops:  make(map[string]bool),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return m, nil
+		}
+		return nil, fmt.Errorf("auth: reading %s: %w", path, err)
+	}
+
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &m.bans); err != nil {
+			return nil, fmt.Errorf("auth: parsing %s: %w", path, err)
+		}
+	}
+
+	now := time.Now()
+	fresh := m.bans[:0]
+	for _, b := range m.bans {
+		if !b.expired(now) {
+			fresh = append(fresh, b)
+		}
+	}
+	m.bans = fresh
+
+	for _, b := range m.bans {
+		m.scheduleExpiry(b)
+	}
+
+	return m, nil
+}
+
+// MakeOperator grants name operator privileges. The first user to
+// connect to the server is made an operator by the caller.
+func (m *Manager) MakeOperator(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops[strings.ToLower(name)] = true
+}
+
+// IsOperator reports whether name currently holds operator privileges.
+func (m *Manager) IsOperator(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ops[strings.ToLower(name)]
+}
+
+// CheckName reports whether name is currently banned.
+func (m *Manager) CheckName(name string) bool {
+	return m.matches(KindName, strings.ToLower(name))
+}
+
+// CheckIP reports whether ip is currently banned.
+func (m *Manager) CheckIP(ip string) bool {
+	return m.matches(KindIP, ip)
+}
+
+// CheckAddr reports whether addr (a full host:port, as returned by
+// net.Conn.RemoteAddr or an *http.Request's RemoteAddr) is currently
+// banned under KindAddr. It does not also check the bare IP; callers
+// that want both bans enforced must call CheckIP separately.
+func (m *Manager) CheckAddr(addr string) bool {
+	return m.matches(KindAddr, addr)
+}
+
+func (m *Manager) matches(kind Kind, value string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, b := range m.bans {
+		if b.Kind == kind && strings.EqualFold(b.Value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ban adds a ban for value under kind. A zero duration bans permanently.
+func (m *Manager) Ban(kind Kind, value string, duration time.Duration) error {
+	ban := Ban{Kind: kind, Value: value}
+	if duration > 0 {
+		ban.Until = time.Now().Add(duration)
+	}
+
+	m.mu.Lock()
+	m.bans = append(m.bans, ban)
+	m.mu.Unlock()
+
+	m.scheduleExpiry(ban)
+
+	return m.persist()
+}
+
+// Unban removes every ban matching kind/value.
+func (m *Manager) Unban(kind Kind, value string) error {
+	m.mu.Lock()
+	kept := m.bans[:0]
+	for _, b := range m.bans {
+		if b.Kind == kind && strings.EqualFold(b.Value, value) {
+			continue
+		}
+		kept = append(kept, b)
+	}
+	m.bans = kept
+	m.mu.Unlock()
+
+	return m.persist()
+}
+
+// List returns a snapshot of the current banlist.
+func (m *Manager) List() []Ban {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make([]Ban, len(m.bans))
+	copy(out, m.bans)
+	return out
+}
+
+// scheduleExpiry arms a timer that drops ban once it expires. Permanent
+// bans (zero Until) are never scheduled.
+func (m *Manager) scheduleExpiry(ban Ban) {
+	if ban.Until.IsZero() {
+		return
+	}
+
+	d := time.Until(ban.Until)
+	if d <= 0 {
+		return
+	}
+
+	time.AfterFunc(d, func() {
+		m.Unban(ban.Kind, ban.Value)
+	})
+}
+
+func (m *Manager) persist() error {
+	m.mu.Lock()
+	data, err := json.MarshalIndent(m.bans, "", "  ")
+	m.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("auth: marshaling banlist: %w", err)
+	}
+
+	if err := os.WriteFile(m.path, data, 0o644); err != nil {
+		return fmt.Errorf("auth: writing %s: %w", m.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(filepath.Join(t.TempDir(), "bans.json"))
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+func TestManagerOperators(t *testing.T) {
+	m := newTestManager(t)
+
+	if m.IsOperator("alice") {
+		t.Fatal("alice should not start as an operator")
+	}
+
+	m.MakeOperator("Alice")
+	if !m.IsOperator("alice") {
+		t.Fatal("MakeOperator should be case-insensitive")
+	}
+}
+
+func TestManagerBanAndCheck(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.Ban(KindName, "Troll", 0); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if !m.CheckName("troll") {
+		t.Fatal("CheckName should match a permanent name ban case-insensitively")
+	}
+	if m.CheckIP("troll") {
+		t.Fatal("a name ban must not also match as an ip ban")
+	}
+
+	if err := m.Ban(KindIP, "10.0.0.1", 0); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if !m.CheckIP("10.0.0.1") {
+		t.Fatal("CheckIP should match a banned ip")
+	}
+
+	if err := m.Ban(KindAddr, "10.0.0.2:5555", 0); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if !m.CheckAddr("10.0.0.2:5555") {
+		t.Fatal("CheckAddr should match a banned host:port")
+	}
+	if m.CheckIP("10.0.0.2") {
+		t.Fatal("an addr ban must not also match as a bare ip ban")
+	}
+}
+
+func TestManagerUnban(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.Ban(KindName, "troll", 0); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if err := m.Unban(KindName, "troll"); err != nil {
+		t.Fatalf("Unban: %v", err)
+	}
+	if m.CheckName("troll") {
+		t.Fatal("CheckName should not match after Unban")
+	}
+}
+
+func TestManagerBanExpiry(t *testing.T) {
+	m := newTestManager(t)
+
+	if err := m.Ban(KindName, "troll", 10*time.Millisecond); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+	if !m.CheckName("troll") {
+		t.Fatal("a timed ban should match immediately")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if m.CheckName("troll") {
+		t.Fatal("a timed ban should stop matching once it expires")
+	}
+}
+
+func TestManagerPersistsAcrossLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bans.json")
+
+	m, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if err := m.Ban(KindIP, "10.0.0.1", 0); err != nil {
+		t.Fatalf("Ban: %v", err)
+	}
+
+	reloaded, err := NewManager(path)
+	if err != nil {
+		t.Fatalf("NewManager (reload): %v", err)
+	}
+	if !reloaded.CheckIP("10.0.0.1") {
+		t.Fatal("a ban should survive reloading the manager from path")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// outBufferSize bounds how many pending messages a client can have
+	// queued before it is considered a slow consumer.
+	outBufferSize = 64
+	// slowConsumerDeadline is how long a client's out channel may stay
+	// full before it gets disconnected.
+	slowConsumerDeadline = 3 * time.Second
+	// heartbeatInterval is how often a keepalive is sent to idle clients.
+	heartbeatInterval = 30 * time.Second
+	// readDeadline is a dead-socket backstop, not an idle-typing limit:
+	// it is refreshed both by the scan loop on every line read and by
+	// writePump on every successful write (including heartbeats), so a
+	// client that only listens without ever typing is never reaped for
+	// being quiet. It only elapses once writes themselves stop getting
+	// through.
+	readDeadline = 3 * heartbeatInterval
+)
+
+// heartbeatPayload is a no-op ANSI reset: harmless to print, but enough
+// to detect a dead socket via its write error.
+const heartbeatPayload = "\x1b[0m"
+
+type client struct {
+	conn      net.Conn
+	username  string
+	writer    *bufio.Writer
+	room      *Room
+	transport string // "tcp" or "ws"
+
+	out  chan []byte
+	done chan struct{}
+
+	mu        sync.Mutex
+	closed    bool
+	slowSince time.Time
+}
+
+func newClient(conn net.Conn, username, transport string) *client {
+	return &client{
+		conn:      conn,
+		username:  username,
+		writer:    bufio.NewWriter(conn),
+		transport: transport,
+		out:       make(chan []byte, outBufferSize),
+		done:      make(chan struct{}),
+	}
+}
+
+// writePump drains c.out and is the only goroutine allowed to write to
+// c.writer, so one stalled peer can no longer block broadcastToRoom. It
+// stops on c.done rather than on c.out being closed: c is removed from
+// every registry before done is closed, but send still has to be safe
+// for any producer that grabbed a reference to c beforehand.
+//
+// A successful write is also this server's only proof that the
+// connection is still alive, so it pushes out c's read deadline;
+// a failed write is the inverse proof and closes c immediately instead
+// of waiting for the read deadline to eventually lapse.
+func (s *Server) writePump(c *client) {
+	for {
+		select {
+		case data := <-c.out:
+			_, err := c.writer.Write(data)
+			if err == nil {
+				err = c.writer.Flush()
+			}
+			if err != nil {
+				c.conn.Close()
+				return
+			}
+			c.conn.SetReadDeadline(time.Now().Add(readDeadline))
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send queues data for c without blocking; a client whose buffer is
+// full is marked as a slow consumer instead. Once c has disconnected it
+// silently drops the message instead of queuing into a buffer nothing
+// is draining anymore.
+func (s *Server) send(c *client, data []byte) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return
+	}
+
+	select {
+	case c.out <- data:
+		c.mu.Lock()
+		c.slowSince = time.Time{}
+		c.mu.Unlock()
+	default:
+		s.markSlow(c)
+	}
+}
+
+// markSlow starts the eviction clock for c the first time its buffer is
+// found full; later calls while it is still slow are no-ops.
+func (s *Server) markSlow(c *client) {
+	c.mu.Lock()
+	alreadySlow := !c.slowSince.IsZero()
+	if !alreadySlow {
+		c.slowSince = time.Now()
+	}
+	c.mu.Unlock()
+
+	if !alreadySlow {
+		time.AfterFunc(slowConsumerDeadline, func() { s.evictIfSlow(c) })
+	}
+}
+
+// evictIfSlow closes c's connection if it has been a slow consumer for
+// at least slowConsumerDeadline without recovering.
+func (s *Server) evictIfSlow(c *client) {
+	c.mu.Lock()
+	stillSlow := !c.slowSince.IsZero() && time.Since(c.slowSince) >= slowConsumerDeadline
+	c.mu.Unlock()
+
+	if stillSlow {
+		c.conn.Close()
+	}
+}
+
+// heartbeat periodically queues a keepalive for c until stop is closed.
+// Queuing it is not itself proof of anything; it is writePump observing
+// the write succeed (and pushing out c's read deadline in response, or
+// closing c on failure) that actually detects whether c is still
+// alive.
+func (s *Server) heartbeat(c *client, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			room := ""
+			if c.room != nil {
+				room = c.room.name
+			}
+			s.deliver(c, "ping", c.username, room, heartbeatPayload)
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/makcimerrr/net-cat/auth"
+)
+
+const helpText = "\x1b[33mAvailable commands:\x1b[0m\n" +
+	"  /ls                    list rooms\n" +
+	"  /cd <name>             join or create a room\n" +
+	"  /who                   list members of your current room\n" +
+	"  /nick <name>           change your username\n" +
+	"  /msg <user> <text>     send a private message\n" +
+	"  /emote <text>          (alias /me) show an action, e.g. * alice waves\n" +
+	"  /log [n|duration]      replay more history (e.g. /log 50, /log 10m)\n" +
+	"  /help                  show this message\n" +
+	"  /quit                  disconnect\n" +
+	"Operator only:\n" +
+	"  /kick <user>           disconnect a user\n" +
+	"  /ban name|ip|addr <value> [duration]  ban a user\n" +
+	"  /unban name|ip|addr <value>           lift a ban\n" +
+	"  /banned                list active bans\n" +
+	"  /op <user>             grant operator privileges\n"
+
+// handleCommand dispatches a leading-slash message to its command
+// handler. It returns true if message was a recognized command (and
+// therefore should not be treated as chat text).
+func (s *Server) handleCommand(c *client, message string) bool {
+	fields := strings.Fields(message)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "/ls":
+		s.cmdListRooms(c)
+	case "/cd":
+		s.cmdChangeRoom(c, fields[1:])
+	case "/who":
+		s.cmdWho(c)
+	case "/nick":
+		s.cmdNick(c, fields[1:])
+	case "/msg":
+		s.cmdMsg(c, fields[1:])
+	case "/emote", "/me":
+		s.cmdEmote(c, fields[1:])
+	case "/log":
+		s.cmdLog(c, fields[1:])
+	case "/help":
+		s.send(c, []byte(helpText))
+	case "/kick":
+		s.cmdKick(c, fields[1:])
+	case "/ban":
+		s.cmdBan(c, fields[1:])
+	case "/unban":
+		s.cmdUnban(c, fields[1:])
+	case "/banned":
+		s.cmdBanned(c)
+	case "/op":
+		s.cmdOp(c, fields[1:])
+	default:
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) cmdListRooms(c *client) {
+	names := s.listRooms()
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("\x1b[33mRooms:\x1b[0m\n")
+	for _, name := range names {
+		marker := "  "
+		if c.room != nil && c.room.name == name {
+			marker = "* "
+		}
+		b.WriteString(marker + name + "\n")
+	}
+
+	s.send(c, []byte(b.String()))
+}
+
+func (s *Server) cmdChangeRoom(c *client, args []string) {
+	if len(args) == 0 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /cd <room>\x1b[0m\n"))
+		return
+	}
+
+	name := args[0]
+	if !strings.HasPrefix(name, "#") {
+		name = "#" + name
+	}
+
+	oldRoom := c.room
+	newRoom := s.getOrCreateRoom(name)
+	if oldRoom == newRoom {
+		return
+	}
+
+	s.notifyRoomLeave(c, oldRoom)
+	s.joinRoom(c, newRoom)
+	s.notifyRoomJoin(c)
+	s.sendChatHistory(c)
+}
+
+func (s *Server) cmdWho(c *client) {
+	members := s.roomMembers(c.room)
+	sort.Strings(members)
+
+	message := fmt.Sprintf("\x1b[33mIn %s: %s\x1b[0m\n", c.room.name, strings.Join(members, ", "))
+	s.send(c, []byte(message))
+}
+
+func (s *Server) cmdNick(c *client, args []string) {
+	if len(args) == 0 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /nick <name>\x1b[0m\n"))
+		return
+	}
+
+	newName := args[0]
+	if existing := s.findClientByName(newName); existing != nil && existing != c {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: username already taken\x1b[0m\n"))
+		return
+	}
+
+	oldName := c.username
+	s.clientsMu.Lock()
+	delete(s.usersByName, strings.ToLower(oldName))
+	c.username = newName
+	s.usersByName[strings.ToLower(newName)] = c
+	s.clientsMu.Unlock()
+
+	body := fmt.Sprintf("%s is now known as %s", oldName, c.username)
+	message := fmt.Sprintf("\x1b[32;1m%s\x1b[0m\n", body)
+	s.broadcastToRoom(c.room, nil, "nick", c.username, message)
+	s.history.Append(HistoryRecord{Ts: time.Now(), Room: c.room.name, Username: c.username, Body: body, Kind: "nick"})
+}
+
+// cmdMsg delivers a private message to one user. It is never appended
+// to the room history: only the sender and the recipient ever see it.
+func (s *Server) cmdMsg(c *client, args []string) {
+	if len(args) < 2 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /msg <user> <text>\x1b[0m\n"))
+		return
+	}
+
+	target := s.findClientByName(args[0])
+	if target == nil {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: no such user\x1b[0m\n"))
+		return
+	}
+
+	text := strings.Join(args[1:], " ")
+	timeStamp := getTimeStamp()
+
+	s.send(target, []byte(fmt.Sprintf("\x1b[35m[%s][%s -> you]: %s\x1b[0m\n", timeStamp, c.username, text)))
+	s.send(c, []byte(fmt.Sprintf("\x1b[35m[%s][you -> %s]: %s\x1b[0m\n", timeStamp, target.username, text)))
+}
+
+// cmdEmote renders text as a third-person action, e.g. "* alice waves".
+func (s *Server) cmdEmote(c *client, args []string) {
+	if len(args) == 0 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /emote <text>\x1b[0m\n"))
+		return
+	}
+
+	text := strings.Join(args, " ")
+	body := s.applyMentions(c, text, "\x1b[3m")
+	message := fmt.Sprintf("\x1b[3m* %s %s\x1b[0m\n", c.username, body)
+
+	s.broadcastToRoom(c.room, c, "emote", c.username, message)
+	s.send(c, []byte(message))
+	s.history.Append(HistoryRecord{Ts: time.Now(), Room: c.room.name, Username: c.username, Body: text, Kind: "emote"})
+}
+
+// cmdLog lets a client request a bigger replay window than the one sent
+// automatically on join: /log 50 replays the last 50 entries, /log 10m
+// replays everything from the last 10 minutes, /log alone repeats the
+// default window.
+func (s *Server) cmdLog(c *client, args []string) {
+	maxCount, maxAge := s.historySize, time.Duration(0)
+
+	if len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			maxCount, maxAge = n, 0
+		} else if d, err := time.ParseDuration(args[0]); err == nil {
+			maxCount, maxAge = 0, d
+		} else {
+			s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /log [n|duration]\x1b[0m\n"))
+			return
+		}
+	}
+
+	s.replayHistory(c, c.room.name, maxCount, maxAge)
+}
+
+func (s *Server) requireOp(c *client) bool {
+	if s.auth.IsOperator(c.username) {
+		return true
+	}
+	s.send(c, []byte("\x1b[31;1m[ERROR]: operator privileges required\x1b[0m\n"))
+	return false
+}
+
+func (s *Server) cmdKick(c *client, args []string) {
+	if !s.requireOp(c) {
+		return
+	}
+	if len(args) == 0 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /kick <user>\x1b[0m\n"))
+		return
+	}
+
+	target := s.findClientByName(args[0])
+	if target == nil {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: no such user\x1b[0m\n"))
+		return
+	}
+
+	s.send(target, []byte("\x1b[31;1mYou have been kicked\x1b[0m\n"))
+	target.conn.Close()
+}
+
+func (s *Server) cmdBan(c *client, args []string) {
+	if !s.requireOp(c) {
+		return
+	}
+	if len(args) < 2 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /ban name|ip|addr <value> [duration]\x1b[0m\n"))
+		return
+	}
+
+	kind, ok := parseBanKind(args[0])
+	if !ok {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: kind must be name, ip or addr\x1b[0m\n"))
+		return
+	}
+	value := args[1]
+
+	var duration time.Duration
+	if len(args) >= 3 {
+		d, err := time.ParseDuration(args[2])
+		if err != nil {
+			s.send(c, []byte(fmt.Sprintf("\x1b[31;1m[ERROR]: invalid duration: %v\x1b[0m\n", err)))
+			return
+		}
+		duration = d
+	}
+
+	if err := s.auth.Ban(kind, value, duration); err != nil {
+		s.send(c, []byte(fmt.Sprintf("\x1b[31;1m[ERROR]: %v\x1b[0m\n", err)))
+		return
+	}
+
+	if kind == auth.KindName {
+		if target := s.findClientByName(value); target != nil {
+			s.send(target, []byte("\x1b[31;1mYou have been banned\x1b[0m\n"))
+			target.conn.Close()
+		}
+	}
+
+	s.send(c, []byte(fmt.Sprintf("\x1b[33mBanned %s %q\x1b[0m\n", kind, value)))
+}
+
+func (s *Server) cmdUnban(c *client, args []string) {
+	if !s.requireOp(c) {
+		return
+	}
+	if len(args) < 2 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /unban name|ip|addr <value>\x1b[0m\n"))
+		return
+	}
+
+	kind, ok := parseBanKind(args[0])
+	if !ok {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: kind must be name, ip or addr\x1b[0m\n"))
+		return
+	}
+
+	if err := s.auth.Unban(kind, args[1]); err != nil {
+		s.send(c, []byte(fmt.Sprintf("\x1b[31;1m[ERROR]: %v\x1b[0m\n", err)))
+		return
+	}
+
+	s.send(c, []byte(fmt.Sprintf("\x1b[33mUnbanned %s %q\x1b[0m\n", kind, args[1])))
+}
+
+// parseBanKind validates the textual kind argument to /ban and /unban,
+// rejecting anything other than name, ip or addr so a typo can't create
+// a permanent, unmatchable ban.
+func parseBanKind(raw string) (auth.Kind, bool) {
+	switch auth.Kind(raw) {
+	case auth.KindName, auth.KindIP, auth.KindAddr:
+		return auth.Kind(raw), true
+	default:
+		return "", false
+	}
+}
+
+func (s *Server) cmdBanned(c *client) {
+	bans := s.auth.List()
+
+	var b strings.Builder
+	b.WriteString("\x1b[33mBanned:\x1b[0m\n")
+	for _, ban := range bans {
+		until := "permanent"
+		if !ban.Until.IsZero() {
+			until = "until " + ban.Until.Format(time.RFC3339)
+		}
+		b.WriteString("  " + string(ban.Kind) + " " + ban.Value + " (" + until + ")\n")
+	}
+
+	s.send(c, []byte(b.String()))
+}
+
+func (s *Server) cmdOp(c *client, args []string) {
+	if !s.requireOp(c) {
+		return
+	}
+	if len(args) == 0 {
+		s.send(c, []byte("\x1b[31;1m[ERROR]: usage: /op <user>\x1b[0m\n"))
+		return
+	}
+
+	s.auth.MakeOperator(args[0])
+	s.send(c, []byte(fmt.Sprintf("\x1b[33m%s is now an operator\x1b[0m\n", args[0])))
+}
+
+func (s *Server) findClientByName(name string) *client {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	return s.usersByName[strings.ToLower(name)]
+}
+
+// reserveUsername atomically checks name against both registered and
+// in-flight (mid-prompt) usernames and, if it is free, reserves it so a
+// second connection racing the same name cannot also pass the check
+// before the first finishes registering. A caller whose reservation
+// succeeds is expected to register the client under the same name,
+// which moves the hold from reservedNames into usersByName.
+func (s *Server) reserveUsername(name string) bool {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	key := strings.ToLower(name)
+	if s.usersByName[key] != nil || s.reservedNames[key] {
+		return false
+	}
+	s.reservedNames[key] = true
+	return true
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// HistoryRecord is one append-only log line: enough to both replay a
+// room's scrollback and re-render it in any transport's format.
+type HistoryRecord struct {
+	Ts       time.Time `json:"ts"`
+	Room     string    `json:"room"`
+	Username string    `json:"username"`
+	Body     string    `json:"body"`
+	Kind     string    `json:"kind"`
+}
+
+// HistoryStore persists chat history to disk and keeps a bounded
+// in-memory window per room for fast replay to newly joined clients.
+type HistoryStore interface {
+	Append(rec HistoryRecord) error
+	Recent(room string, maxCount int, maxAge time.Duration) []HistoryRecord
+}
+
+// fileHistoryStore appends every record as one JSON line to a file and
+// mirrors the last windowSize records per room in memory, so a restart
+// rehydrates by tailing the file instead of replaying nothing.
+type fileHistoryStore struct {
+	mu         sync.Mutex
+	file       *os.File
+	windowSize int
+	rooms      map[string][]HistoryRecord
+}
+
+// NewFileHistoryStore opens (or creates) path and tails it to rebuild
+// the per-room in-memory windows, each bounded to windowSize entries.
+func NewFileHistoryStore(path string, windowSize int) (*fileHistoryStore, error) {
+	s := &fileHistoryStore{windowSize: windowSize, rooms: make(map[string][]HistoryRecord)}
+
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec HistoryRecord
+			if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+				continue // skip a corrupt line rather than fail startup
+			}
+			s.remember(rec)
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("history: reading %s: %w", path, err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("history: opening %s: %w", path, err)
+	}
+	s.file = file
+
+	return s, nil
+}
+
+// Append writes rec to disk and updates its room's in-memory window.
+func (s *fileHistoryStore) Append(rec HistoryRecord) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("history: marshaling record: %w", err)
+	}
+
+	s.mu.Lock()
+	_, err = s.file.Write(append(data, '\n'))
+	if err == nil {
+		s.remember(rec)
+	}
+	s.mu.Unlock()
+
+	return err
+}
+
+// remember appends rec to its room's window, trimming the oldest entry
+// once windowSize is exceeded. Callers must hold mu.
+func (s *fileHistoryStore) remember(rec HistoryRecord) {
+	window := append(s.rooms[rec.Room], rec)
+	if len(window) > s.windowSize {
+		window = window[len(window)-s.windowSize:]
+	}
+	s.rooms[rec.Room] = window
+}
+
+// Recent returns up to maxCount of the most recent records for room that
+// are newer than maxAge (maxAge <= 0 means no age limit). Both are
+// capped by the store's in-memory window: a bigger request only sees
+// what is still resident, not the full on-disk log.
+func (s *fileHistoryStore) Recent(room string, maxCount int, maxAge time.Duration) []HistoryRecord {
+	s.mu.Lock()
+	window := s.rooms[room]
+	s.mu.Unlock()
+
+	if maxAge > 0 {
+		cutoff := time.Now().Add(-maxAge)
+		filtered := make([]HistoryRecord, 0, len(window))
+		for _, rec := range window {
+			if rec.Ts.After(cutoff) {
+				filtered = append(filtered, rec)
+			}
+		}
+		window = filtered
+	}
+
+	if maxCount > 0 && len(window) > maxCount {
+		window = window[len(window)-maxCount:]
+	}
+
+	out := make([]HistoryRecord, len(window))
+	copy(out, window)
+	return out
+}
+
+// renderRecord turns a stored record back into the ANSI-colored line the
+// rest of the server already sends for that kind of event.
+func renderRecord(rec HistoryRecord) string {
+	switch rec.Kind {
+	case "join":
+		return fmt.Sprintf("\x1b[32;1m%s has joined %s\x1b[0m\n", rec.Username, rec.Room)
+	case "leave":
+		return fmt.Sprintf("\x1b[31;1m%s has left %s\x1b[0m\n", rec.Username, rec.Room)
+	case "nick":
+		return fmt.Sprintf("\x1b[32;1m%s\x1b[0m\n", rec.Body)
+	case "emote":
+		return fmt.Sprintf("\x1b[3m* %s %s\x1b[0m\n", rec.Username, rec.Body)
+	default:
+		return fmt.Sprintf("\x1b[36m[%s][%s]: %s\x1b[0m\n", rec.Ts.Format("2006-01-02 15:04:05"), rec.Username, rec.Body)
+	}
+}
@@ -2,41 +2,60 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/atotto/clipboard"
 	"github.com/chzyer/readline"
+	"github.com/makcimerrr/net-cat/auth"
 )
 
-type client struct {
-	conn     net.Conn
-	username string
-	writer   *bufio.Writer
-}
-
-var (
-	clients       []*client
-	clientsMu     sync.Mutex
-	chatHistory   []string
-	activeClients int
-	maxClients    = 10
-)
+const usage = "[USAGE]: %s [port] [-ws addr] [-history-size n] [-history-file path]"
 
 func main() {
 	port := 8989
-	if len(os.Args) > 1 {
-		p, err := strconv.Atoi(os.Args[1])
-		if err != nil {
-			log.Fatalf("[USAGE]: %s $port", os.Args[0])
+	wsAddr := ""
+	historySize := 100
+	historyFile := "chat.log"
+
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-ws":
+			if i+1 >= len(args) {
+				log.Fatalf(usage, os.Args[0])
+			}
+			wsAddr = args[i+1]
+			i++
+		case "-history-size":
+			if i+1 >= len(args) {
+				log.Fatalf(usage, os.Args[0])
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				log.Fatalf(usage, os.Args[0])
+			}
+			historySize = n
+			i++
+		case "-history-file":
+			if i+1 >= len(args) {
+				log.Fatalf(usage, os.Args[0])
+			}
+			historyFile = args[i+1]
+			i++
+		default:
+			p, err := strconv.Atoi(args[i])
+			if err != nil {
+				log.Fatalf(usage, os.Args[0])
+			}
+			port = p
 		}
-		port = p
 	}
 
 	ip, err := getIPv4Address()
@@ -44,6 +63,18 @@ func main() {
 		log.Fatalf("Failed to get IPv4 address: %v", err)
 	}
 
+	authMgr, err := auth.NewManager("bans.json")
+	if err != nil {
+		log.Fatalf("Failed to load banlist: %v", err)
+	}
+
+	history, err := NewFileHistoryStore(historyFile, historySize)
+	if err != nil {
+		log.Fatalf("Failed to load chat history: %v", err)
+	}
+
+	server := NewServer(10, authMgr, history, historySize)
+
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		log.Fatal("Failed to start server:", err)
@@ -62,6 +93,10 @@ func main() {
 
 	log.Printf("Server started, listening on port %d, paste in terminal to connect", port)
 
+	if wsAddr != "" {
+		go server.serveWS(wsAddr)
+	}
+
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
@@ -69,14 +104,25 @@ func main() {
 			continue
 		}
 
-		if activeClients >= maxClients {
+		remoteAddr := conn.RemoteAddr().String()
+		remoteIP, _, _ := net.SplitHostPort(remoteAddr)
+		if server.auth.CheckIP(remoteIP) || server.auth.CheckAddr(remoteAddr) {
+			conn.Write([]byte("\x1b[31;1m[ERROR]: you are banned from this server\x1b[0m\n"))
+			conn.Close()
+			continue
+		}
+
+		server.clientsMu.Lock()
+		if server.activeClients >= server.maxClients {
+			server.clientsMu.Unlock()
 			conn.Write([]byte("Maximum number of clients reached. Please try again later.\n"))
 			conn.Close()
 			continue
 		}
+		server.activeClients++
+		server.clientsMu.Unlock()
 
-		activeClients++
-		go handleConnection(conn)
+		go server.handleConnection(conn)
 	}
 }
 
@@ -95,47 +141,95 @@ func getIPv4Address() (string, error) {
 	return "", fmt.Errorf("no ipv4 address found")
 }
 
-func handleConnection(conn net.Conn) {
+func (s *Server) handleConnection(conn net.Conn) {
 	sendWelcomeMessage(conn)
 
-	username := getUsername(conn)
-	client := &client{
-		conn:     conn,
-		username: username,
-		writer:   bufio.NewWriter(conn),
+	username := s.getUsername(conn)
+	if username == "" {
+		conn.Close()
+		s.clientsMu.Lock()
+		s.activeClients--
+		s.clientsMu.Unlock()
+		return
 	}
 
-	clientsMu.Lock()
-	clients = append(clients, client)
-	clientsMu.Unlock()
+	transport := "tcp"
+	if _, ok := conn.(*wsConn); ok {
+		transport = "ws"
+	}
+
+	c := newClient(conn, username, transport)
+
+	s.clientsMu.Lock()
+	isFirstUser := len(s.clients) == 0
+	s.clients = append(s.clients, c)
+	s.usersByName[strings.ToLower(c.username)] = c
+	delete(s.reservedNames, strings.ToLower(c.username))
+	s.clientsMu.Unlock()
+
+	if isFirstUser {
+		s.auth.MakeOperator(c.username)
+	}
 
-	notifyJoin(client)
+	go s.writePump(c)
 
-	sendChatHistory(client)
+	stopHeartbeat := make(chan struct{})
+	go s.heartbeat(c, stopHeartbeat)
+
+	s.joinRoom(c, s.getOrCreateRoom(defaultRoomName))
+	s.notifyRoomJoin(c)
+
+	s.sendChatHistory(c)
+
+	conn.SetReadDeadline(time.Now().Add(readDeadline))
 
 	scanner := bufio.NewScanner(conn)
 	for scanner.Scan() {
 		message := scanner.Text()
+		conn.SetReadDeadline(time.Now().Add(readDeadline))
 
 		if strings.ToLower(message) == "/quit" {
 			break
 		}
 
-		sendMessage(client, message)
+		if strings.HasPrefix(message, "/") {
+			if s.handleCommand(c, message) {
+				continue
+			}
+		}
+
+		s.sendMessage(c, message)
 	}
 
+	close(stopHeartbeat)
 	conn.Close()
 
-	clientsMu.Lock()
-	removeClient(client)
-	clientsMu.Unlock()
+	// Remove c from every registry before marking it closed, so no
+	// other goroutine can still look it up (via s.clients, a room or
+	// usersByName) and queue a send after writePump stops draining it.
+	s.clientsMu.Lock()
+	s.removeClient(c)
+	s.clientsMu.Unlock()
+
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+	close(c.done)
 
-	notifyLeave(client)
+	s.notifyRoomLeave(c, c.room)
 
-	activeClients--
+	s.clientsMu.Lock()
+	s.activeClients--
+	s.clientsMu.Unlock()
 }
 
-func getUsername(conn net.Conn) string {
+// getUsername prompts conn for a username, rejecting empty, banned or
+// already-taken names (so /msg can target a username unambiguously). A
+// name that passes is reserved atomically under clientsMu so a second
+// connection racing the same name cannot also pass the check before
+// handleConnection finishes registering this one. It returns "" if the
+// connection closes banned or mid-prompt.
+func (s *Server) getUsername(conn net.Conn) string {
 	conn.Write([]byte("\x1b[35;1;4m[ENTER YOUR USERNAME]: \x1b[0m"))
 
 	scanner := bufio.NewScanner(conn)
@@ -143,50 +237,39 @@ func getUsername(conn net.Conn) string {
 		username := scanner.Text()
 		if username == "" {
 			conn.Write([]byte("\x1b[31;1m[ERROR]: Username cannot be empty\x1b[0m\n"))
-			return getUsername(conn) // Demander à nouveau le nom d'utilisateur
+			return s.getUsername(conn) // Demander à nouveau le nom d'utilisateur
+		}
+		if s.auth.CheckName(username) {
+			conn.Write([]byte("\x1b[31;1m[ERROR]: this username is banned\x1b[0m\n"))
+			return ""
+		}
+		if !s.reserveUsername(username) {
+			conn.Write([]byte("\x1b[31;1m[ERROR]: username already taken\x1b[0m\n"))
+			return s.getUsername(conn)
 		}
 		return username
 	}
 
-	return "unknown"
-}
-
-func notifyJoin(c *client) {
-	message := fmt.Sprintf("\x1b[32;1m%s has joined the chat\x1b[0m\n", c.username)
-	broadcastMessage(c, message)
-	clientsMu.Lock()
-	chatHistory = append(chatHistory, message)
-	clientsMu.Unlock()
-}
-
-func notifyLeave(c *client) {
-	message := fmt.Sprintf("\x1b[31;1m%s has left the chat\x1b[0m\n", c.username)
-	broadcastMessage(nil, message)
-	clientsMu.Lock()
-	chatHistory = append(chatHistory, message)
-	clientsMu.Unlock()
+	return ""
 }
 
-func sendMessage(sender *client, message string) {
+func (s *Server) sendMessage(sender *client, message string) {
 	timeStamp := getTimeStamp() // Obtenir l'horodatage actuel
 
 	if strings.TrimSpace(message) == "" {
 		// Si le message est vide, envoyer uniquement l'horodatage et le nom d'utilisateur à l'expéditeur
 		msg := fmt.Sprintf("\x1b[36m[%s][%s]:\x1b[0m\n", timeStamp, sender.username)
-		sender.writer.WriteString(msg)
-		sender.writer.Flush()
+		s.send(sender, []byte(msg))
 		return // Ne pas envoyer de message vide aux autres clients
 	}
-	msg := fmt.Sprintf("\x1b[36m[%s][%s]: %s\x1b[0m\n", timeStamp, sender.username, message)
-	broadcastMessage(sender, msg)
+	body := s.applyMentions(sender, message, "\x1b[36m")
+	msg := fmt.Sprintf("\x1b[36m[%s][%s]: %s\x1b[0m\n", timeStamp, sender.username, body)
+	s.broadcastToRoom(sender.room, sender, "chat", sender.username, msg)
 
 	// Afficher le message avec l'horodatage dans le terminal de l'expéditeur
-	sender.writer.WriteString(msg)
-	sender.writer.Flush()
+	s.send(sender, []byte(msg))
 
-	clientsMu.Lock()
-	chatHistory = append(chatHistory, msg)
-	clientsMu.Unlock()
+	s.history.Append(HistoryRecord{Ts: time.Now(), Room: sender.room.name, Username: sender.username, Body: message, Kind: "chat"})
 }
 
 func sendWelcomeMessage(conn net.Conn) {
@@ -230,43 +313,65 @@ func formatWelcomeMessage(message string) string {
 	return formattedMessage
 }
 
-func broadcastMessage(sender *client, message string) {
-	clientsMu.Lock()
-	defer clientsMu.Unlock()
+// broadcastToRoom fans a message out to every member of room except
+// sender (pass nil to include everyone). kind and user describe the
+// event for clients on a structured transport (e.g. WebSocket); tcp
+// clients just get the pre-rendered ANSI line.
+func (s *Server) broadcastToRoom(room *Room, sender *client, kind, user, message string) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
 
-	for _, c := range clients {
+	for _, c := range room.clients {
 		if sender == nil || c != sender {
-			c.writer.WriteString(message)
-			c.writer.Flush()
+			s.deliver(c, kind, user, room.name, message)
 		}
 	}
 }
 
-func sendChatHistory(c *client) {
-	clientsMu.Lock()
-	defer clientsMu.Unlock()
+// sendChatHistory replays the room's default history window (the full
+// in-memory window, no age limit) to a newly joined client.
+func (s *Server) sendChatHistory(c *client) {
+	s.replayHistory(c, c.room.name, s.historySize, 0)
+}
 
-	for _, msg := range chatHistory {
-		c.writer.WriteString(msg)
-		c.writer.Flush()
+// replayHistory sends up to maxCount records younger than maxAge
+// (maxAge <= 0 means no age limit) from room to c.
+func (s *Server) replayHistory(c *client, room string, maxCount int, maxAge time.Duration) {
+	for _, rec := range s.history.Recent(room, maxCount, maxAge) {
+		s.deliver(c, "history", rec.Username, rec.Room, renderRecord(rec))
 	}
+}
 
-	/* for _, client := range clients {
-		if client != c {
-			message := fmt.Sprintf("[%s] %s has joined the chat\n", getTimeStamp(), client.username)
-			c.writer.WriteString(message)
-			c.writer.Flush()
-		}
-	} */
+// deliver queues message for c, translating it into the client's
+// transport: nc clients get the raw ANSI-colored line, ws clients get a
+// JSON frame with the ANSI codes stripped out.
+func (s *Server) deliver(c *client, kind, user, room, message string) {
+	if c.transport != "ws" {
+		s.send(c, []byte(message))
+		return
+	}
+
+	frame := wsFrame{Type: kind, User: user, Room: room, Body: stripANSI(message), Ts: time.Now().Unix()}
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return
+	}
+	s.send(c, append(data, '\n'))
 }
 
-func removeClient(c *client) {
-	for i, client := range clients {
+// removeClient drops c from the client registry, the username index and
+// its room. Callers must hold clientsMu.
+func (s *Server) removeClient(c *client) {
+	for i, client := range s.clients {
 		if client == c {
-			clients = append(clients[:i], clients[i+1:]...)
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
 			break
 		}
 	}
+	if s.usersByName[strings.ToLower(c.username)] == c {
+		delete(s.usersByName, strings.ToLower(c.username))
+	}
+	removeFromRoom(c.room, c)
 }
 
 func getTimeStamp() string {
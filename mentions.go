@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var mentionPattern = regexp.MustCompile(`@(\w+)`)
+
+// applyMentions highlights every @username token that matches a
+// currently connected client and rings that client's terminal bell.
+// resumeColor is the ANSI sequence to fall back to after the mention's
+// own color, so the highlight doesn't bleed into the rest of the line.
+func (s *Server) applyMentions(sender *client, text, resumeColor string) string {
+	return mentionPattern.ReplaceAllStringFunc(text, func(token string) string {
+		target := s.findClientByName(token[1:])
+		if target == nil {
+			return token
+		}
+
+		if target != sender {
+			s.send(target, []byte("\x07"))
+		}
+
+		return fmt.Sprintf("\x1b[33;1m@%s\x1b[0m%s", target.username, resumeColor)
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// defaultRoomName is the room every new connection lands in.
+const defaultRoomName = "#lobby"
+
+// Room groups the clients that exchange messages together; its
+// scrollback lives in the server's HistoryStore, keyed by name.
+type Room struct {
+	name    string
+	clients []*client
+}
+
+// getOrCreateRoom returns the named room, creating it on first use.
+func (s *Server) getOrCreateRoom(name string) *Room {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	room, ok := s.rooms[name]
+	if !ok {
+		room = &Room{name: name}
+		s.rooms[name] = room
+	}
+	return room
+}
+
+// listRooms returns the names of every known room, populated or not.
+func (s *Server) listRooms() []string {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	names := make([]string, 0, len(s.rooms))
+	for name := range s.rooms {
+		names = append(names, name)
+	}
+	return names
+}
+
+// joinRoom moves c into room, leaving its previous room first.
+func (s *Server) joinRoom(c *client, room *Room) {
+	s.clientsMu.Lock()
+	if c.room != nil {
+		removeFromRoom(c.room, c)
+	}
+	room.clients = append(room.clients, c)
+	c.room = room
+	s.clientsMu.Unlock()
+}
+
+// removeFromRoom drops c from room.clients. Callers must hold clientsMu.
+func removeFromRoom(room *Room, c *client) {
+	for i, member := range room.clients {
+		if member == c {
+			room.clients = append(room.clients[:i], room.clients[i+1:]...)
+			break
+		}
+	}
+}
+
+// roomMembers returns the usernames currently present in room.
+func (s *Server) roomMembers(room *Room) []string {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	names := make([]string, 0, len(room.clients))
+	for _, c := range room.clients {
+		names = append(names, c.username)
+	}
+	return names
+}
+
+func (s *Server) notifyRoomJoin(c *client) {
+	message := fmt.Sprintf("\x1b[32;1m%s has joined %s\x1b[0m\n", c.username, c.room.name)
+	s.broadcastToRoom(c.room, c, "join", c.username, message)
+	s.history.Append(HistoryRecord{Ts: time.Now(), Room: c.room.name, Username: c.username, Kind: "join"})
+}
+
+// notifyRoomLeave announces c's departure from room to its other
+// members. c is passed as the sender to exclude so that, when called
+// while c is still a member (e.g. from /cd before the actual room
+// switch), it does not see its own "has left" line.
+func (s *Server) notifyRoomLeave(c *client, room *Room) {
+	message := fmt.Sprintf("\x1b[31;1m%s has left %s\x1b[0m\n", c.username, room.name)
+	s.broadcastToRoom(room, c, "leave", c.username, message)
+	s.history.Append(HistoryRecord{Ts: time.Now(), Room: room.name, Username: c.username, Kind: "leave"})
+}
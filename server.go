@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/makcimerrr/net-cat/auth"
+)
+
+// Server owns every piece of shared state a connection handler needs:
+// the client registry, the room index and the auth/ban manager. It
+// replaces the package-level globals the server used to rely on so that
+// state can be constructed (and tested) independently of main().
+type Server struct {
+	clientsMu     sync.Mutex
+	clients       []*client
+	usersByName   map[string]*client // lowercase username -> client, guarded by clientsMu
+	reservedNames map[string]bool    // lowercase username -> held during the username prompt, guarded by clientsMu
+	activeClients int
+	maxClients    int
+
+	roomsMu sync.Mutex
+	rooms   map[string]*Room
+
+	auth *auth.Manager
+
+	history     HistoryStore
+	historySize int
+}
+
+// NewServer builds a Server with the default lobby room and the given
+// client cap, auth manager and history store.
+func NewServer(maxClients int, authMgr *auth.Manager, history HistoryStore, historySize int) *Server {
+	return &Server{
+		maxClients:    maxClients,
+		usersByName:   make(map[string]*client),
+		reservedNames: make(map[string]bool),
+		rooms:         map[string]*Room{defaultRoomName: {name: defaultRoomName}},
+		auth:          authMgr,
+		history:       history,
+		historySize:   historySize,
+	}
+}
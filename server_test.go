@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/makcimerrr/net-cat/auth"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	authMgr, err := auth.NewManager(filepath.Join(t.TempDir(), "bans.json"))
+	if err != nil {
+		t.Fatalf("auth.NewManager: %v", err)
+	}
+	history, err := NewFileHistoryStore(filepath.Join(t.TempDir(), "chat.log"), 10)
+	if err != nil {
+		t.Fatalf("NewFileHistoryStore: %v", err)
+	}
+
+	return NewServer(2, authMgr, history, 10)
+}
+
+func TestNewServerStartsWithLobby(t *testing.T) {
+	s := newTestServer(t)
+
+	if _, ok := s.rooms[defaultRoomName]; !ok {
+		t.Fatalf("NewServer should pre-create the default room %q", defaultRoomName)
+	}
+	if len(s.clients) != 0 || len(s.usersByName) != 0 {
+		t.Fatal("a fresh Server should start with no clients")
+	}
+}
+
+func TestReserveUsername(t *testing.T) {
+	s := newTestServer(t)
+
+	if !s.reserveUsername("alice") {
+		t.Fatal("reserving a free username should succeed")
+	}
+	if s.reserveUsername("Alice") {
+		t.Fatal("reserving an already-reserved username (any case) should fail")
+	}
+
+	delete(s.reservedNames, "alice")
+	if !s.reserveUsername("alice") {
+		t.Fatal("a released reservation should be reservable again")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// wsFrame is the JSON envelope exchanged with browser clients connected
+// over the WebSocket transport, mirroring the plain-text line sent to
+// nc clients.
+type wsFrame struct {
+	Type string `json:"type"`
+	User string `json:"user"`
+	Room string `json:"room"`
+	Body string `json:"body"`
+	Ts   int64  `json:"ts"`
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func stripANSI(s string) string {
+	return ansiEscape.ReplaceAllString(s, "")
+}
+
+// wsConn adapts a websocket connection to the net.Conn shape
+// handleConnection expects: Write sends one text message per call, and
+// Read decodes a queued wsFrame back into the line the existing
+// bufio.Scanner read loop expects (re-appending the trailing newline),
+// so handleConnection does not need to know it is talking to a
+// browser. A payload that isn't valid JSON is passed through as-is,
+// which keeps the bare-text username prompt working for clients that
+// don't frame that first message.
+type wsConn struct {
+	conn     *websocket.Conn
+	ctx      context.Context
+	pending  []byte
+	lastRoom string
+}
+
+func newWSConn(conn *websocket.Conn) *wsConn {
+	return &wsConn{conn: conn, ctx: context.Background()}
+}
+
+func (w *wsConn) Read(p []byte) (int, error) {
+	for len(w.pending) == 0 {
+		_, data, err := w.conn.Read(w.ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		var frame wsFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			w.pending = append(data, '\n')
+			continue
+		}
+
+		var line []byte
+		if frame.Room != "" && frame.Room != w.lastRoom {
+			line = append(line, "/cd "+frame.Room+"\n"...)
+			w.lastRoom = frame.Room
+		}
+		w.pending = append(line, frame.Body+"\n"...)
+	}
+	n := copy(p, w.pending)
+	w.pending = w.pending[n:]
+	return n, nil
+}
+
+func (w *wsConn) Write(p []byte) (int, error) {
+	if err := w.conn.Write(w.ctx, websocket.MessageText, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *wsConn) Close() error { return w.conn.Close(websocket.StatusNormalClosure, "") }
+
+func (w *wsConn) LocalAddr() net.Addr  { return wsAddr{} }
+func (w *wsConn) RemoteAddr() net.Addr { return wsAddr{} }
+
+func (w *wsConn) SetDeadline(t time.Time) error { return nil }
+
+// SetReadDeadline is a no-op: the websocket library has no per-read
+// deadline hook. This means the dead-socket reaping handleConnection
+// does for nc clients (refreshing conn's read deadline on every scan
+// and letting it lapse after readDeadline) never kicks in for
+// WebSocket clients; one that vanishes without sending a close frame
+// stays registered until the underlying TCP connection itself dies.
+func (w *wsConn) SetReadDeadline(t time.Time) error { return nil }
+
+func (w *wsConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// wsAddr is a placeholder net.Addr: the websocket library does not expose
+// the underlying TCP address, only the *http.Request we upgraded from.
+type wsAddr struct{}
+
+func (wsAddr) Network() string { return "ws" }
+func (wsAddr) String() string  { return "websocket" }
+
+// serveWS runs an HTTP server at addr that upgrades every request to a
+// WebSocket and hands it to handleConnection alongside the plain TCP
+// listener, so nc and browser clients share the same rooms.
+func (s *Server) serveWS(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		wsc, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			log.Println("ws: upgrade failed:", err)
+			return
+		}
+
+		remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if s.auth.CheckIP(remoteIP) || s.auth.CheckAddr(r.RemoteAddr) {
+			wsc.Close(websocket.StatusPolicyViolation, "banned")
+			return
+		}
+
+		s.clientsMu.Lock()
+		full := s.activeClients >= s.maxClients
+		if !full {
+			s.activeClients++
+		}
+		s.clientsMu.Unlock()
+		if full {
+			wsc.Close(websocket.StatusTryAgainLater, "server full")
+			return
+		}
+
+		s.handleConnection(newWSConn(wsc))
+	})
+
+	log.Printf("Serving WebSocket transport on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Println("ws: server stopped:", err)
+	}
+}